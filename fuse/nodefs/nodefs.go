@@ -0,0 +1,82 @@
+// Package nodefs provides the bridge between the raw, nodeid-oriented
+// kernel dispatch in the fuse package and higher-level filesystem
+// implementations such as pathfs. It deliberately mirrors the older,
+// simpler go-fuse architecture where a filesystem implements
+// fuse.RawFileSystem directly, rather than a separate generic node tree:
+// pathfs.PathNodeFs already maintains its own path<->nodeid bookkeeping,
+// so a second one here would just be duplicated state.
+package nodefs
+
+import (
+	"github.com/bpowers/go-fuse/fuse"
+)
+
+// Node is what MountRoot mounts: a filesystem implementation that
+// understands the kernel's nodeid-based raw protocol, plus a hook to
+// learn about the FileSystemConnector it was mounted with.
+// pathfs.PathNodeFs is the Node implementation filesystems built on
+// pathfs.FileSystem use.
+type Node interface {
+	fuse.RawFileSystem
+
+	// OnMount is called once, right after the mount is established,
+	// so the Node can keep the connector around for later use (e.g.
+	// sending invalidation notifications).
+	OnMount(conn *FileSystemConnector)
+}
+
+// File represents a single open file handle. It exists so that
+// pathfs.FileSystem.Open has a return type to hand back to callers that
+// need one; this package does not otherwise interpret it.
+type File interface {
+	String() string
+}
+
+// Options configures a mount. Its only option is Debug, which MountRoot
+// passes to the root's SetDebug; a nil *Options is always valid and
+// leaves debugging as the root has it.
+type Options struct {
+	Debug bool
+}
+
+// FileSystemConnector is the handle returned alongside the fuse.Server by
+// MountRoot. It exposes the operations a mounted filesystem needs that
+// aren't part of the request/reply cycle, such as kernel cache
+// invalidation.
+type FileSystemConnector struct {
+	server *fuse.Server
+}
+
+// Server returns the fuse.Server this connector is attached to.
+func (c *FileSystemConnector) Server() *fuse.Server {
+	return c.server
+}
+
+// FileNotify invalidates the kernel's cached attributes and page cache
+// for nodeid.
+func (c *FileSystemConnector) FileNotify(nodeid uint64, off int64, length int64) fuse.Status {
+	return c.server.InodeNotify(nodeid, off, length)
+}
+
+// EntryNotify invalidates the kernel's cached dentry for name within
+// parent.
+func (c *FileSystemConnector) EntryNotify(parent uint64, name string) fuse.Status {
+	return c.server.EntryNotify(parent, name)
+}
+
+// MountRoot mounts root at mountPoint and returns the running
+// fuse.Server together with the FileSystemConnector wrapping it. Serve
+// must be called (usually in its own goroutine) to actually start
+// processing kernel requests.
+func MountRoot(mountPoint string, root Node, opts *Options) (*fuse.Server, *FileSystemConnector, error) {
+	if opts != nil {
+		root.SetDebug(opts.Debug)
+	}
+	server, err := fuse.NewServer(root, mountPoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn := &FileSystemConnector{server: server}
+	root.OnMount(conn)
+	return server, conn, nil
+}
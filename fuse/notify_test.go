@@ -0,0 +1,99 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// TestInodeNotifyWritesRawNotify pins down what pathfs.TestNotifyXAttr
+// can't: that InodeNotify actually writes a FUSE_NOTIFY_INVAL_INODE
+// message to the kernel fd. pathfs's test only observes the effect
+// through a real mount, where Server never populates AttrValid/
+// EntryValid in the first place - so GetXAttr is served fresh on every
+// call whether or not NotifyXAttr does anything, and the test would
+// pass identically if InodeNotify were a no-op. Here we substitute a
+// pipe for /dev/fuse and inspect the bytes Server actually wrote.
+func TestInodeNotifyWritesRawNotify(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe failed: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	s := &Server{fd: int(w.Fd())}
+
+	if code := s.InodeNotify(42, 7, 11); !code.Ok() {
+		t.Fatalf("InodeNotify failed: %v", code)
+	}
+
+	buf := make([]byte, sizeOfOutHeader+24)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatalf("reading notify message failed: %v", err)
+	}
+	if n != len(buf) {
+		t.Fatalf("notify message is %d bytes, want %d", n, len(buf))
+	}
+
+	var out outHeader
+	binary.Read(bytes.NewReader(buf[:sizeOfOutHeader]), binary.LittleEndian, &out)
+	if out.Unique != 0 {
+		t.Errorf("notify Unique = %d, want 0 (notifications aren't replies)", out.Unique)
+	}
+	if out.Error != -notifyInvalInode {
+		t.Errorf("notify code = %d, want %d (FUSE_NOTIFY_INVAL_INODE)", -out.Error, notifyInvalInode)
+	}
+
+	var inval notifyInvalInodeOut
+	binary.Read(bytes.NewReader(buf[sizeOfOutHeader:]), binary.LittleEndian, &inval)
+	if inval.Ino != 42 || inval.Off != 7 || inval.Len != 11 {
+		t.Errorf("notify payload = %+v, want {Ino:42 Off:7 Len:11}", inval)
+	}
+}
+
+// TestEntryNotifyWritesRawNotify is EntryNotify's equivalent of
+// TestInodeNotifyWritesRawNotify: it confirms the FUSE_NOTIFY_INVAL_ENTRY
+// message and entry name actually land on the wire.
+func TestEntryNotifyWritesRawNotify(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe failed: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	s := &Server{fd: int(w.Fd())}
+
+	if code := s.EntryNotify(7, "stale-name"); !code.Ok() {
+		t.Fatalf("EntryNotify failed: %v", code)
+	}
+
+	buf := make([]byte, sizeOfOutHeader+16+len("stale-name")+1)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatalf("reading notify message failed: %v", err)
+	}
+	if n != len(buf) {
+		t.Fatalf("notify message is %d bytes, want %d", n, len(buf))
+	}
+
+	var out outHeader
+	binary.Read(bytes.NewReader(buf[:sizeOfOutHeader]), binary.LittleEndian, &out)
+	if out.Error != -notifyInvalEntry {
+		t.Errorf("notify code = %d, want %d (FUSE_NOTIFY_INVAL_ENTRY)", -out.Error, notifyInvalEntry)
+	}
+
+	var inval notifyInvalEntryOut
+	body := buf[sizeOfOutHeader:]
+	binary.Read(bytes.NewReader(body), binary.LittleEndian, &inval)
+	if inval.Parent != 7 || inval.Namelen != uint32(len("stale-name")) {
+		t.Errorf("notify payload = %+v, want Parent:7 Namelen:%d", inval, len("stale-name"))
+	}
+	gotName := string(body[16 : 16+inval.Namelen])
+	if gotName != "stale-name" {
+		t.Errorf("notify name = %q, want %q", gotName, "stale-name")
+	}
+}
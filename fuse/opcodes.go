@@ -0,0 +1,33 @@
+package fuse
+
+// Kernel opcode numbers, from the subset of <linux/fuse.h> that Server
+// actually dispatches. Server only implements the small slice of the
+// protocol pathfs/nodefs need (lookups, attributes, mkdir/unlink/rmdir,
+// open/release/flush, access and xattr calls);
+// unrecognized opcodes are answered with ENOSYS so the kernel falls back
+// to sane defaults or surfaces a clear error to the caller.
+const (
+	opLookup      = 1
+	opForget      = 2
+	opGetAttr     = 3
+	opMkdir       = 9
+	opUnlink      = 10
+	opRmdir       = 11
+	opOpen        = 14
+	opRelease     = 18
+	opFlush       = 25
+	opSetXAttr    = 21
+	opGetXAttr    = 22
+	opListXAttr   = 23
+	opRemoveXAttr = 24
+	opInit        = 26
+	opAccess      = 34
+	opDestroy     = 38
+)
+
+// Notification codes the server can push to the kernel outside of the
+// request/reply cycle (see Server.InodeNotify/EntryNotify).
+const (
+	notifyInvalInode = 2
+	notifyInvalEntry = 3
+)
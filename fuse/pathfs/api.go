@@ -0,0 +1,97 @@
+// Package pathfs lets callers implement a FUSE filesystem in terms of
+// full path strings rather than the kernel's inode numbers. PathNodeFs
+// adapts a FileSystem into the nodeid-oriented fuse.RawFileSystem the
+// fuse package's Server dispatches to.
+package pathfs
+
+import (
+	"github.com/bpowers/go-fuse/fuse"
+	"github.com/bpowers/go-fuse/fuse/nodefs"
+)
+
+// FileSystem is the path-based interface filesystems built on pathfs
+// implement. Every method receives the full path of the node relative
+// to the mount root ("" or "/" for the root itself).
+//
+// This interface covers the operations PathNodeFs dispatches, plus
+// Readlink and OpenDir, which PathNodeFs never calls but
+// OverlayFileSystem layers; NewDefaultFileSystem gives every method a safe ENOSYS
+// default so implementations only need to override what they support,
+// the same way XAttrTestFs embeds it and only overrides the handful of
+// methods its tests exercise.
+type FileSystem interface {
+	String() string
+	SetDebug(debug bool)
+
+	GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status)
+	Readlink(name string, context *fuse.Context) (string, fuse.Status)
+	Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status)
+	OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status)
+	Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status
+	Unlink(name string, context *fuse.Context) fuse.Status
+	Rmdir(name string, context *fuse.Context) fuse.Status
+
+	GetXAttr(name string, attribute string, dest []byte, context *fuse.Context) (size int, code fuse.Status)
+	ListXAttr(name string, context *fuse.Context) (attributes []string, code fuse.Status)
+	SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status
+	RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status
+}
+
+// defaultFileSystem answers every FileSystem method with ENOSYS (or the
+// equivalent zero value), so embedders only need to implement the
+// operations they actually support.
+type defaultFileSystem struct{}
+
+// NewDefaultFileSystem returns a FileSystem whose methods all report
+// ENOSYS. Embed it - as XAttrTestFs and OverlayFileSystem's Upper layer
+// do - and override the methods you implement.
+func NewDefaultFileSystem() FileSystem {
+	return (*defaultFileSystem)(nil)
+}
+
+func (fs *defaultFileSystem) String() string { return "DefaultFileSystem" }
+func (fs *defaultFileSystem) SetDebug(bool)  {}
+
+func (fs *defaultFileSystem) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	return nil, fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	return "", fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	return nil, fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
+	return nil, fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) Unlink(name string, context *fuse.Context) fuse.Status {
+	return fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) Rmdir(name string, context *fuse.Context) fuse.Status {
+	return fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) GetXAttr(name string, attribute string, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	return nil, fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	return fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	return fuse.ENOSYS
+}
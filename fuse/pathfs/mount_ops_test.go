@@ -0,0 +1,148 @@
+package pathfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpowers/go-fuse/fuse"
+	"github.com/bpowers/go-fuse/fuse/nodefs"
+)
+
+// mountOpsFs is a minimal in-memory FileSystem exercising Mkdir, Unlink,
+// Rmdir and Open through a real mount, the gap TestOverlay* left
+// untested since those tests only ever call the Go API directly.
+type mountOpsFs struct {
+	files map[string]bool
+	dirs  map[string]bool
+
+	FileSystem
+}
+
+func newMountOpsFs() *mountOpsFs {
+	return &mountOpsFs{
+		files:      map[string]bool{},
+		dirs:       map[string]bool{"": true},
+		FileSystem: NewDefaultFileSystem(),
+	}
+}
+
+func (fs *mountOpsFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if fs.dirs[name] {
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0755}, fuse.OK
+	}
+	if fs.files[name] {
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0644}, fuse.OK
+	}
+	return nil, fuse.ENOENT
+}
+
+func (fs *mountOpsFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
+	if !fs.dirs[name] {
+		return nil, fuse.ENOENT
+	}
+	return nil, fuse.OK
+}
+
+func (fs *mountOpsFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	if fs.dirs[name] || fs.files[name] {
+		return fuse.EEXIST
+	}
+	fs.dirs[name] = true
+	return fuse.OK
+}
+
+func (fs *mountOpsFs) Unlink(name string, context *fuse.Context) fuse.Status {
+	if !fs.files[name] {
+		return fuse.ENOENT
+	}
+	delete(fs.files, name)
+	return fuse.OK
+}
+
+func (fs *mountOpsFs) Rmdir(name string, context *fuse.Context) fuse.Status {
+	if !fs.dirs[name] {
+		return fuse.ENOENT
+	}
+	delete(fs.dirs, name)
+	return fuse.OK
+}
+
+func (fs *mountOpsFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if !fs.files[name] {
+		return nil, fuse.ENOENT
+	}
+	return mountOpsFile{name}, fuse.OK
+}
+
+type mountOpsFile struct{ name string }
+
+func (f mountOpsFile) String() string { return "mountOpsFile(" + f.name + ")" }
+
+func mountOpsTestCase(t *testing.T) (fs *mountOpsFs, mountPoint string, cleanup func()) {
+	fs = newMountOpsFs()
+	fs.files["afile"] = true
+	fs.dirs["adir"] = true
+
+	mountPoint, err := ioutil.TempDir("", "go-fuse-mount-ops_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+
+	nfs := NewPathNodeFs(fs, nil)
+	state, _, err := nodefs.MountRoot(mountPoint, nfs.Root(), nil)
+	if err != nil {
+		t.Fatalf("MountRoot failed: %v", err)
+	}
+	state.SetDebug(VerboseTest())
+
+	go state.Serve()
+	return fs, mountPoint, func() {
+		state.Unmount()
+		os.RemoveAll(mountPoint)
+	}
+}
+
+// TestMountMkdirUnlinkRmdir exercises Mkdir, Unlink and Rmdir through a
+// real mount, via the same os.Mkdir/os.Remove syscalls a shell would
+// issue, rather than calling the FileSystem methods directly.
+func TestMountMkdirUnlinkRmdir(t *testing.T) {
+	fs, mountPoint, clean := mountOpsTestCase(t)
+	defer clean()
+
+	if err := os.Mkdir(filepath.Join(mountPoint, "newdir"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if !fs.dirs["newdir"] {
+		t.Error("Mkdir did not reach the filesystem")
+	}
+
+	if err := os.Remove(filepath.Join(mountPoint, "afile")); err != nil {
+		t.Fatalf("Remove(file) failed: %v", err)
+	}
+	if fs.files["afile"] {
+		t.Error("Unlink did not reach the filesystem")
+	}
+
+	if err := os.Remove(filepath.Join(mountPoint, "adir")); err != nil {
+		t.Fatalf("Remove(dir) failed: %v", err)
+	}
+	if fs.dirs["adir"] {
+		t.Error("Rmdir did not reach the filesystem")
+	}
+}
+
+// TestMountOpen exercises Open/Release through a real mount.
+func TestMountOpen(t *testing.T) {
+	_, mountPoint, clean := mountOpsTestCase(t)
+	defer clean()
+
+	f, err := os.Open(filepath.Join(mountPoint, "afile"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package pathfs
+
+import (
+	"github.com/bpowers/go-fuse/fuse"
+)
+
+// NotifyXAttr invalidates the kernel's cache of the extended attributes
+// of path, so the next getxattr/listxattr call is served fresh from the
+// FileSystem rather than from the attribute-timeout cache. Use this when
+// something outside the FUSE mount - e.g. another process calling
+// setxattr directly on the backing store - changes xattr state that
+// PathNodeFs doesn't otherwise know about.
+//
+// It returns ENOSYS if the negotiated kernel protocol does not support
+// invalidation notifications.
+func (fs *PathNodeFs) NotifyXAttr(path string, attr string) fuse.Status {
+	if !fs.connector.Server().Protocol().HasInvalidate() {
+		return fuse.ENOSYS
+	}
+	node, ok := fs.LookupNode(path)
+	if !ok {
+		return fuse.ENOENT
+	}
+	return fs.connector.FileNotify(node, 0, 0)
+}
+
+// NotifyEntry invalidates the kernel's dentry cache for name within
+// parent, so the next lookup re-queries the FileSystem instead of
+// trusting a cached, possibly stale, result. As with NotifyXAttr, this
+// requires a kernel connection that supports invalidation.
+func (fs *PathNodeFs) NotifyEntry(parent string, name string) fuse.Status {
+	if !fs.connector.Server().Protocol().HasInvalidate() {
+		return fuse.ENOSYS
+	}
+	node, ok := fs.LookupNode(parent)
+	if !ok {
+		return fuse.ENOENT
+	}
+	return fs.connector.EntryNotify(node, name)
+}
@@ -0,0 +1,58 @@
+package pathfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpowers/go-fuse/fuse/nodefs"
+)
+
+// TestNotifyXAttr is an end-to-end smoke test: it exercises NotifyXAttr
+// through a real mount, the way a caller actually uses it. It does not
+// by itself prove InodeNotify wrote anything to the kernel, since Server
+// never populates AttrValid/EntryValid and so GetXAttr is always served
+// fresh regardless of notification - fuse.TestInodeNotifyWritesRawNotify
+// is what pins down the wire-level behavior.
+func TestNotifyXAttr(t *testing.T) {
+	nm := xattrFilename
+	xfs := NewXAttrFs(nm, xattrGolden)
+	xfs.tester = t
+
+	mountPoint, err := ioutil.TempDir("", "go-fuse-notify_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(mountPoint)
+
+	nfs := NewPathNodeFs(xfs, nil)
+	state, _, err := nodefs.MountRoot(mountPoint, nfs.Root(), nil)
+	if err != nil {
+		t.Fatalf("MountRoot failed: %v", err)
+	}
+	state.SetDebug(VerboseTest())
+	go state.Serve()
+	defer state.Unmount()
+
+	mounted := filepath.Join(mountPoint, nm)
+
+	// read once, so the kernel looks the file up and NotifyXAttr has a
+	// nodeid to notify.
+	if _, err := readXAttr(mounted, "user.attr1"); err != nil {
+		t.Fatalf("initial GetXAttr failed: %v", err)
+	}
+
+	// mutate the backing store directly, bypassing the mount, the way
+	// an external process would.
+	xfs.attrs["user.attr1"] = []byte("updated")
+
+	if code := nfs.NotifyXAttr(nm, "user.attr1"); !code.Ok() {
+		t.Fatalf("NotifyXAttr failed: %v", code)
+	}
+
+	val, err := readXAttr(mounted, "user.attr1")
+	if err != nil || string(val) != "updated" {
+		t.Errorf("GetXAttr after NotifyXAttr = %q, %v, want \"updated\", nil", val, err)
+	}
+}
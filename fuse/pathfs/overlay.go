@@ -0,0 +1,302 @@
+package pathfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/bpowers/go-fuse/fuse"
+	"github.com/bpowers/go-fuse/fuse/nodefs"
+)
+
+// xattrWhiteout and xattrOpaque are the markers OverlayFileSystem writes
+// to its Upper layer to record deletions and directory opacity, mirroring
+// the kernel overlayfs on-disk format closely enough that the intent is
+// recognizable, without depending on root privileges to create real
+// whiteout device nodes.
+const (
+	xattrWhiteout = "trusted.overlay.whiteout"
+	xattrOpaque   = "trusted.overlay.opaque"
+)
+
+// xattrTombstonePrefix marks an individual extended attribute as removed,
+// the xattr-level equivalent of xattrWhiteout. Without it, RemoveXAttr on
+// a name whose attribute value came from Lower would have nothing to
+// remove in Upper, and the next GetXAttr/ListXAttr would resurrect the
+// value straight out of Lower.
+const xattrTombstonePrefix = "trusted.overlay.removed."
+
+func xattrTombstoneName(attr string) string {
+	return xattrTombstonePrefix + attr
+}
+
+// OverlayFileSystem composes a read-only Lower FileSystem with a
+// writable Upper one, the same model as the kernel's overlayfs, but
+// implemented entirely in terms of two pathfs.FileSystem instances so it
+// can be stacked inside a single FUSE mount. Reads that find no entry in
+// Upper fall through to Lower; all mutations - including SetXAttr and
+// RemoveXAttr - land in Upper, which is never written to Lower.
+//
+// Deleting a path that Lower has an opinion on is recorded as a whiteout
+// xattr on Upper rather than touching Lower. This makes an in-memory map
+// such as XAttrTestFs a viable Upper layer over any read-only Lower
+// FileSystem.
+type OverlayFileSystem struct {
+	Lower FileSystem
+	Upper FileSystem
+
+	// FileSystem is always Upper. Every method FileSystem declares is
+	// overridden below; this embedding exists so OverlayFileSystem
+	// satisfies FileSystem without a forwarding stub for each method,
+	// and so a method added to the interface later defaults to Upper's
+	// behavior instead of failing to compile.
+	FileSystem
+}
+
+// NewOverlayFileSystem returns an OverlayFileSystem layering upper over
+// lower.
+func NewOverlayFileSystem(lower, upper FileSystem) *OverlayFileSystem {
+	return &OverlayFileSystem{
+		Lower:      lower,
+		Upper:      upper,
+		FileSystem: upper,
+	}
+}
+
+func (fs *OverlayFileSystem) String() string {
+	return fmt.Sprintf("OverlayFileSystem(upper=%s, lower=%s)", fs.Upper.String(), fs.Lower.String())
+}
+
+func (fs *OverlayFileSystem) SetDebug(debug bool) {
+	fs.Lower.SetDebug(debug)
+	fs.Upper.SetDebug(debug)
+}
+
+func (fs *OverlayFileSystem) isWhiteout(name string, context *fuse.Context) bool {
+	_, code := fs.Upper.GetXAttr(name, xattrWhiteout, make([]byte, 1), context)
+	return code.Ok()
+}
+
+func (fs *OverlayFileSystem) isOpaque(name string, context *fuse.Context) bool {
+	_, code := fs.Upper.GetXAttr(name, xattrOpaque, make([]byte, 1), context)
+	return code.Ok()
+}
+
+func (fs *OverlayFileSystem) isXAttrTombstoned(name, attr string, context *fuse.Context) bool {
+	_, code := fs.Upper.GetXAttr(name, xattrTombstoneName(attr), make([]byte, 1), context)
+	return code.Ok()
+}
+
+func (fs *OverlayFileSystem) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if fs.isWhiteout(name, context) {
+		return nil, fuse.ENOENT
+	}
+	if a, code := fs.Upper.GetAttr(name, context); code.Ok() {
+		return a, fuse.OK
+	}
+	return fs.Lower.GetAttr(name, context)
+}
+
+func (fs *OverlayFileSystem) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	if fs.isWhiteout(name, context) {
+		return "", fuse.ENOENT
+	}
+	if target, code := fs.Upper.Readlink(name, context); code.Ok() {
+		return target, code
+	}
+	return fs.Lower.Readlink(name, context)
+}
+
+func (fs *OverlayFileSystem) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if fs.isWhiteout(name, context) {
+		return nil, fuse.ENOENT
+	}
+	if f, code := fs.Upper.Open(name, flags, context); code.Ok() {
+		return f, code
+	}
+	return fs.Lower.Open(name, flags, context)
+}
+
+// OpenDir merges Upper and Lower directory listings. Names Upper lists
+// with a whiteout are left out, and so are Lower entries of the same
+// name. If name is marked opaque in Upper, Lower's contents are not
+// merged in at all, matching overlayfs "opaque directory" semantics.
+func (fs *OverlayFileSystem) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
+	upperEntries, upperCode := fs.Upper.OpenDir(name, context)
+	if upperCode != fuse.OK && upperCode != fuse.ENOENT {
+		return nil, upperCode
+	}
+
+	seen := make(map[string]bool, len(upperEntries))
+	result := make([]fuse.DirEntry, 0, len(upperEntries))
+	for _, e := range upperEntries {
+		seen[e.Name] = true
+		if fs.isWhiteout(filepath.Join(name, e.Name), context) {
+			continue
+		}
+		result = append(result, e)
+	}
+
+	if fs.isOpaque(name, context) {
+		return result, fuse.OK
+	}
+
+	lowerEntries, lowerCode := fs.Lower.OpenDir(name, context)
+	if lowerCode != fuse.OK {
+		if upperCode == fuse.OK {
+			return result, fuse.OK
+		}
+		return nil, lowerCode
+	}
+	for _, e := range lowerEntries {
+		if seen[e.Name] {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result, fuse.OK
+}
+
+func (fs *OverlayFileSystem) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	if fs.isWhiteout(name, context) {
+		return fuse.ENOENT
+	}
+	if code := fs.Upper.SetXAttr(name, attr, data, flags, context); !code.Ok() {
+		return code
+	}
+	// A value now lives in Upper, so any earlier RemoveXAttr tombstone
+	// for attr no longer applies; drop it rather than leave it to
+	// accumulate as unreachable bookkeeping on Upper.
+	fs.Upper.RemoveXAttr(name, xattrTombstoneName(attr), context)
+	return fuse.OK
+}
+
+func (fs *OverlayFileSystem) GetXAttr(name string, attr string, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	if fs.isWhiteout(name, context) {
+		return 0, fuse.ENOENT
+	}
+	if sz, code := fs.Upper.GetXAttr(name, attr, dest, context); code.Ok() || code == fuse.Status(syscall.ERANGE) {
+		return sz, code
+	}
+	if fs.isXAttrTombstoned(name, attr, context) {
+		return 0, fuse.ENODATA
+	}
+	return fs.Lower.GetXAttr(name, attr, dest, context)
+}
+
+func (fs *OverlayFileSystem) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	if fs.isWhiteout(name, context) {
+		return nil, fuse.ENOENT
+	}
+	upper, code := fs.Upper.ListXAttr(name, context)
+	if code != fuse.OK && code != fuse.ENOENT {
+		return nil, code
+	}
+	seen := make(map[string]bool, len(upper))
+	result := make([]string, 0, len(upper))
+	for _, a := range upper {
+		if a == xattrWhiteout || a == xattrOpaque || strings.HasPrefix(a, xattrTombstonePrefix) {
+			continue
+		}
+		seen[a] = true
+		result = append(result, a)
+	}
+
+	lower, lowerCode := fs.Lower.ListXAttr(name, context)
+	if lowerCode != fuse.OK {
+		return result, fuse.OK
+	}
+	for _, a := range lower {
+		if seen[a] || fs.isXAttrTombstoned(name, a, context) {
+			continue
+		}
+		result = append(result, a)
+	}
+	return result, fuse.OK
+}
+
+// RemoveXAttr removes attr from Upper if present there, then - if Lower
+// still has a value for attr - records a per-attribute tombstone on
+// Upper so the removal survives without ever mutating Lower, the same
+// way Unlink whiteouts a whole path.
+func (fs *OverlayFileSystem) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	if fs.isWhiteout(name, context) {
+		return fuse.ENOENT
+	}
+	code := fs.Upper.RemoveXAttr(name, attr, context)
+	if !code.Ok() && code != fuse.ENODATA {
+		return code
+	}
+	if _, lowerCode := fs.Lower.GetXAttr(name, attr, nil, context); lowerCode.Ok() || lowerCode == fuse.Status(syscall.ERANGE) {
+		return fs.Upper.SetXAttr(name, xattrTombstoneName(attr), []byte{'y'}, 0, context)
+	}
+	return code
+}
+
+// GetNsXAttr implements NamespacedXAttrFileSystem by reassembling the
+// fully qualified name and falling through to GetXAttr; OverlayFileSystem
+// doesn't otherwise need to treat namespaces differently on reads.
+func (fs *OverlayFileSystem) GetNsXAttr(name, namespace, attr string, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	return fs.GetXAttr(name, namespace+"."+attr, dest, context)
+}
+
+// SetNsXAttr implements NamespacedXAttrFileSystem. For system.posix_acl_access
+// and system.posix_acl_default it rejects a value that doesn't decode as a
+// well-formed POSIX ACL before it ever reaches Upper, so a malformed
+// setfacl(1) call fails cleanly instead of leaving Upper holding bytes
+// nothing can parse back out; every other namespace is just forwarded to
+// SetXAttr.
+func (fs *OverlayFileSystem) SetNsXAttr(name, namespace, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	full := namespace + "." + attr
+	if full == XAttrACLAccess || full == XAttrACLDefault {
+		if _, err := DecodePosixACL(data); err != nil {
+			return fuse.EINVAL
+		}
+	}
+	return fs.SetXAttr(name, full, data, flags, context)
+}
+
+// Unlink removes name from Upper if present there, then - if Lower still
+// has an opinion on name - records a whiteout so the deletion survives
+// without ever mutating Lower.
+func (fs *OverlayFileSystem) Unlink(name string, context *fuse.Context) fuse.Status {
+	code := fs.Upper.Unlink(name, context)
+	if !code.Ok() && code != fuse.ENOENT {
+		return code
+	}
+	if _, lowerCode := fs.Lower.GetAttr(name, context); lowerCode.Ok() {
+		return fs.Upper.SetXAttr(name, xattrWhiteout, []byte{'y'}, 0, context)
+	}
+	return code
+}
+
+// Rmdir removes name from Upper if present there, then - if Lower still
+// has an opinion on name - records a whiteout so the deletion survives
+// without ever mutating Lower. It cannot simply delegate to Unlink: a
+// real Upper filesystem rejects directory removal via unlink(2)
+// semantics, so directories need their own Rmdir call into Upper.
+func (fs *OverlayFileSystem) Rmdir(name string, context *fuse.Context) fuse.Status {
+	code := fs.Upper.Rmdir(name, context)
+	if !code.Ok() && code != fuse.ENOENT {
+		return code
+	}
+	if _, lowerCode := fs.Lower.GetAttr(name, context); lowerCode.Ok() {
+		return fs.Upper.SetXAttr(name, xattrWhiteout, []byte{'y'}, 0, context)
+	}
+	return code
+}
+
+// Mkdir creates name in Upper, and - if Lower already has a directory by
+// that name - marks it opaque so the (now logically replaced) Lower
+// contents don't reappear in OpenDir.
+func (fs *OverlayFileSystem) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	code := fs.Upper.Mkdir(name, mode, context)
+	if !code.Ok() {
+		return code
+	}
+	if _, lowerCode := fs.Lower.GetAttr(name, context); lowerCode.Ok() {
+		return fs.Upper.SetXAttr(name, xattrOpaque, []byte{'y'}, 0, context)
+	}
+	return fuse.OK
+}
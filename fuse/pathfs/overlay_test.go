@@ -0,0 +1,319 @@
+package pathfs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/bpowers/go-fuse/fuse"
+)
+
+// overlayMemFs is a minimal in-memory FileSystem, along the same lines as
+// XAttrTestFs, but supporting an arbitrary set of names so it can stand
+// in for either layer of an OverlayFileSystem in tests.
+type overlayMemFs struct {
+	files     map[string]bool
+	dirs      map[string]bool
+	attrs     map[string]map[string][]byte
+	unlinkErr fuse.Status // forced error for Unlink, for testing error propagation
+
+	FileSystem
+}
+
+func newOverlayMemFs(files ...string) *overlayMemFs {
+	fs := &overlayMemFs{
+		files:      make(map[string]bool),
+		dirs:       make(map[string]bool),
+		attrs:      make(map[string]map[string][]byte),
+		FileSystem: NewDefaultFileSystem(),
+	}
+	for _, f := range files {
+		fs.files[f] = true
+	}
+	return fs
+}
+
+func (fs *overlayMemFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if name == "" || name == "/" || fs.dirs[name] {
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0755}, fuse.OK
+	}
+	if fs.files[name] {
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0644}, fuse.OK
+	}
+	return nil, fuse.ENOENT
+}
+
+func (fs *overlayMemFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	fs.files[name] = true
+	m := fs.attrs[name]
+	if m == nil {
+		m = make(map[string][]byte)
+		fs.attrs[name] = m
+	}
+	dest := make([]byte, len(data))
+	copy(dest, data)
+	m[attr] = dest
+	return fuse.OK
+}
+
+func (fs *overlayMemFs) GetXAttr(name string, attr string, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	v, ok := fs.attrs[name][attr]
+	if !ok {
+		return 0, fuse.ENODATA
+	}
+	if len(dest) < len(v) {
+		return len(v), fuse.Status(syscall.ERANGE)
+	}
+	return copy(dest, v), fuse.OK
+}
+
+func (fs *overlayMemFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	var names []string
+	for k := range fs.attrs[name] {
+		names = append(names, k)
+	}
+	return names, fuse.OK
+}
+
+func (fs *overlayMemFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	if _, ok := fs.attrs[name][attr]; !ok {
+		return fuse.ENODATA
+	}
+	delete(fs.attrs[name], attr)
+	return fuse.OK
+}
+
+func (fs *overlayMemFs) Unlink(name string, context *fuse.Context) fuse.Status {
+	if fs.unlinkErr != fuse.OK {
+		return fs.unlinkErr
+	}
+	if fs.dirs[name] {
+		return fuse.EISDIR
+	}
+	if !fs.files[name] {
+		return fuse.ENOENT
+	}
+	delete(fs.files, name)
+	delete(fs.attrs, name)
+	return fuse.OK
+}
+
+func (fs *overlayMemFs) Rmdir(name string, context *fuse.Context) fuse.Status {
+	if !fs.dirs[name] {
+		return fuse.ENOENT
+	}
+	delete(fs.dirs, name)
+	delete(fs.attrs, name)
+	return fuse.OK
+}
+
+func TestOverlayXAttrReadThrough(t *testing.T) {
+	lower := newOverlayMemFs("shared")
+	lower.SetXAttr("shared", "user.from", []byte("lower"), 0, nil)
+	upper := newOverlayMemFs()
+
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	if _, code := ofs.GetAttr("shared", nil); !code.Ok() {
+		t.Fatalf("GetAttr(shared) = %v, want OK", code)
+	}
+
+	val := make([]byte, 16)
+	n, code := ofs.GetXAttr("shared", "user.from", val, nil)
+	if !code.Ok() || string(val[:n]) != "lower" {
+		t.Errorf("GetXAttr = %q, %v, want \"lower\", OK", val[:n], code)
+	}
+}
+
+func TestOverlaySetXAttrGoesToUpper(t *testing.T) {
+	lower := newOverlayMemFs("shared")
+	upper := newOverlayMemFs("shared")
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	if code := ofs.SetXAttr("shared", "user.from", []byte("upper"), 0, nil); !code.Ok() {
+		t.Fatalf("SetXAttr failed: %v", code)
+	}
+	if _, ok := lower.attrs["shared"]["user.from"]; ok {
+		t.Error("SetXAttr leaked into the lower layer")
+	}
+
+	val := make([]byte, 16)
+	n, code := ofs.GetXAttr("shared", "user.from", val, nil)
+	if !code.Ok() || string(val[:n]) != "upper" {
+		t.Errorf("GetXAttr after SetXAttr = %q, %v, want \"upper\", OK", val[:n], code)
+	}
+}
+
+func TestOverlayUnlinkWhiteout(t *testing.T) {
+	lower := newOverlayMemFs("lower-only")
+	upper := newOverlayMemFs()
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	if _, code := ofs.GetAttr("lower-only", nil); !code.Ok() {
+		t.Fatalf("precondition: GetAttr(lower-only) = %v, want OK", code)
+	}
+
+	if code := ofs.Unlink("lower-only", nil); !code.Ok() {
+		t.Fatalf("Unlink failed: %v", code)
+	}
+
+	if _, code := ofs.GetAttr("lower-only", nil); code != fuse.ENOENT {
+		t.Errorf("GetAttr after Unlink = %v, want ENOENT", code)
+	}
+	if _, code := lower.GetAttr("lower-only", nil); !code.Ok() {
+		t.Error("Unlink mutated the lower layer")
+	}
+}
+
+func TestOverlayWhiteoutHidesXAttrs(t *testing.T) {
+	lower := newOverlayMemFs("lower-only")
+	lower.SetXAttr("lower-only", "user.from", []byte("lower"), 0, nil)
+	upper := newOverlayMemFs()
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	if code := ofs.Unlink("lower-only", nil); !code.Ok() {
+		t.Fatalf("Unlink failed: %v", code)
+	}
+
+	if _, code := ofs.GetXAttr("lower-only", "user.from", make([]byte, 16), nil); code != fuse.ENOENT {
+		t.Errorf("GetXAttr after Unlink = %v, want ENOENT", code)
+	}
+	if _, code := ofs.ListXAttr("lower-only", nil); code != fuse.ENOENT {
+		t.Errorf("ListXAttr after Unlink = %v, want ENOENT", code)
+	}
+	if code := ofs.SetXAttr("lower-only", "user.from", []byte("new"), 0, nil); code != fuse.ENOENT {
+		t.Errorf("SetXAttr after Unlink = %v, want ENOENT", code)
+	}
+	if code := ofs.RemoveXAttr("lower-only", "user.from", nil); code != fuse.ENOENT {
+		t.Errorf("RemoveXAttr after Unlink = %v, want ENOENT", code)
+	}
+}
+
+func TestOverlayRmdirUsesUpperRmdir(t *testing.T) {
+	lower := newOverlayMemFs()
+	lower.dirs["lower-dir"] = true
+	upper := newOverlayMemFs()
+	upper.dirs["adir"] = true
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	// A directory that only exists in Upper: Rmdir must call
+	// Upper.Rmdir, not Upper.Unlink (which overlayMemFs, like a real
+	// filesystem, rejects for directories with EISDIR).
+	if code := ofs.Rmdir("adir", nil); !code.Ok() {
+		t.Fatalf("Rmdir(adir) = %v, want OK", code)
+	}
+	if upper.dirs["adir"] {
+		t.Error("Rmdir did not remove the upper directory")
+	}
+
+	// A directory that only exists in Lower: Rmdir whiteouts it in
+	// Upper without ever touching Lower.
+	if code := ofs.Rmdir("lower-dir", nil); !code.Ok() {
+		t.Fatalf("Rmdir(lower-dir) = %v, want OK", code)
+	}
+	if _, code := ofs.GetAttr("lower-dir", nil); code != fuse.ENOENT {
+		t.Errorf("GetAttr after Rmdir = %v, want ENOENT", code)
+	}
+	if !lower.dirs["lower-dir"] {
+		t.Error("Rmdir mutated the lower layer")
+	}
+}
+
+func TestOverlayUnlinkPropagatesUpperError(t *testing.T) {
+	lower := newOverlayMemFs("shared")
+	upper := newOverlayMemFs("shared")
+	upper.unlinkErr = fuse.EPERM
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	if code := ofs.Unlink("shared", nil); code != fuse.EPERM {
+		t.Errorf("Unlink = %v, want EPERM", code)
+	}
+	if !upper.files["shared"] {
+		t.Error("Unlink removed the upper file despite the forced error")
+	}
+	if upper.attrs["shared"][xattrWhiteout] != nil {
+		t.Error("Unlink recorded a whiteout despite the upper delete failing")
+	}
+}
+
+func TestOverlayRemoveXAttrInheritedFromLower(t *testing.T) {
+	lower := newOverlayMemFs("shared")
+	lower.SetXAttr("shared", "user.x", []byte("lowerval"), 0, nil)
+	upper := newOverlayMemFs("shared")
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	// Precondition: the attribute is only visible via Lower.
+	val := make([]byte, 16)
+	if n, code := ofs.GetXAttr("shared", "user.x", val, nil); !code.Ok() || string(val[:n]) != "lowerval" {
+		t.Fatalf("precondition: GetXAttr = %q, %v, want \"lowerval\", OK", val[:n], code)
+	}
+
+	if code := ofs.RemoveXAttr("shared", "user.x", nil); !code.Ok() {
+		t.Fatalf("RemoveXAttr = %v, want OK", code)
+	}
+
+	if _, code := ofs.GetXAttr("shared", "user.x", val, nil); code != fuse.ENODATA {
+		t.Errorf("GetXAttr after RemoveXAttr = %v, want ENODATA", code)
+	}
+	names, _ := ofs.ListXAttr("shared", nil)
+	for _, n := range names {
+		if n == "user.x" {
+			t.Errorf("ListXAttr after RemoveXAttr still lists user.x: %v", names)
+		}
+	}
+	if _, code := lower.GetXAttr("shared", "user.x", val, nil); !code.Ok() {
+		t.Error("RemoveXAttr mutated the lower layer")
+	}
+}
+
+func TestOverlaySetNsXAttrValidatesACL(t *testing.T) {
+	lower := newOverlayMemFs("shared")
+	upper := newOverlayMemFs("shared")
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	acl := EncodePosixACL([]ACLEntry{
+		{Tag: ACLUserObj, Perm: 0x7, Id: aclUndefinedID},
+		{Tag: ACLGroupObj, Perm: 0x5, Id: aclUndefinedID},
+		{Tag: ACLOther, Perm: 0x5, Id: aclUndefinedID},
+	})
+
+	if code := dispatchSetXAttr(ofs, "shared", XAttrACLAccess, acl, 0, nil); !code.Ok() {
+		t.Fatalf("SetXAttr(%s) failed: %v", XAttrACLAccess, code)
+	}
+
+	dest := make([]byte, len(acl))
+	n, code := dispatchGetXAttr(ofs, "shared", XAttrACLAccess, dest, nil)
+	if !code.Ok() {
+		t.Fatalf("GetXAttr(%s) failed: %v", XAttrACLAccess, code)
+	}
+	entries, err := DecodePosixACL(dest[:n])
+	if err != nil {
+		t.Fatalf("DecodePosixACL(readback) failed: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Tag != ACLUserObj {
+		t.Errorf("readback ACL = %+v, want 3 entries starting with ACLUserObj", entries)
+	}
+
+	if code := dispatchSetXAttr(ofs, "shared", XAttrACLAccess, []byte("not an acl"), 0, nil); code != fuse.EINVAL {
+		t.Errorf("SetXAttr(%s, malformed) = %v, want EINVAL", XAttrACLAccess, code)
+	}
+}
+
+func TestOverlayRemoveXAttrThenReSet(t *testing.T) {
+	lower := newOverlayMemFs("shared")
+	lower.SetXAttr("shared", "user.x", []byte("lowerval"), 0, nil)
+	upper := newOverlayMemFs("shared")
+	ofs := NewOverlayFileSystem(lower, upper)
+
+	if code := ofs.RemoveXAttr("shared", "user.x", nil); !code.Ok() {
+		t.Fatalf("RemoveXAttr = %v, want OK", code)
+	}
+	if code := ofs.SetXAttr("shared", "user.x", []byte("upperval"), 0, nil); !code.Ok() {
+		t.Fatalf("SetXAttr = %v, want OK", code)
+	}
+
+	val := make([]byte, 16)
+	n, code := ofs.GetXAttr("shared", "user.x", val, nil)
+	if !code.Ok() || string(val[:n]) != "upperval" {
+		t.Errorf("GetXAttr after RemoveXAttr+SetXAttr = %q, %v, want \"upperval\", OK", val[:n], code)
+	}
+}
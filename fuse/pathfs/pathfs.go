@@ -0,0 +1,271 @@
+package pathfs
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bpowers/go-fuse/fuse"
+	"github.com/bpowers/go-fuse/fuse/nodefs"
+)
+
+// rootNodeId is the nodeid the kernel always uses to refer to a mount's
+// root; FUSE reserves it.
+const rootNodeId = 1
+
+// PathNodeFsOptions is reserved for future mount tuning. It is currently
+// empty; NewPathNodeFs accepts a nil *PathNodeFsOptions.
+type PathNodeFsOptions struct{}
+
+// PathNodeFs adapts a path-based FileSystem into the nodeid-based
+// fuse.RawFileSystem that fuse.Server dispatches to, by maintaining a
+// two-way mapping between the kernel's nodeids and the paths they refer
+// to.
+type PathNodeFs struct {
+	fs FileSystem
+
+	connector *nodefs.FileSystemConnector
+
+	mu         sync.Mutex
+	pathToNode map[string]uint64
+	nodeToPath map[uint64]string
+	nextNodeId uint64
+
+	handles map[uint64]nodefs.File
+	nextFh  uint64
+}
+
+// NewPathNodeFs returns a PathNodeFs serving fs. Pass its Root() to
+// nodefs.MountRoot.
+func NewPathNodeFs(fs FileSystem, opts *PathNodeFsOptions) *PathNodeFs {
+	return &PathNodeFs{
+		fs:         fs,
+		pathToNode: map[string]uint64{"": rootNodeId},
+		nodeToPath: map[uint64]string{rootNodeId: ""},
+		nextNodeId: rootNodeId + 1,
+		handles:    map[uint64]nodefs.File{},
+		nextFh:     1,
+	}
+}
+
+// Root returns the Node to hand to nodefs.MountRoot.
+func (p *PathNodeFs) Root() nodefs.Node {
+	return p
+}
+
+func (p *PathNodeFs) String() string {
+	return fmt.Sprintf("PathNodeFs(%s)", p.fs.String())
+}
+
+func (p *PathNodeFs) SetDebug(debug bool) {
+	p.fs.SetDebug(debug)
+}
+
+// Init is called automatically once the kernel handshake completes. It
+// does nothing: PathNodeFs reaches the fuse.Server through the connector
+// OnMount records.
+func (p *PathNodeFs) Init(server *fuse.Server) {}
+
+// OnMount records the FileSystemConnector created for this mount, so
+// NotifyXAttr/NotifyEntry have something to send invalidations through.
+func (p *PathNodeFs) OnMount(conn *nodefs.FileSystemConnector) {
+	p.connector = conn
+}
+
+func pathJoin(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
+
+// LookupNode returns the nodeid the kernel currently holds for path, if
+// any lookup has made the kernel aware of it yet.
+func (p *PathNodeFs) LookupNode(path string) (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.pathToNode[path]
+	return id, ok
+}
+
+func (p *PathNodeFs) pathOf(nodeid uint64) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	path, ok := p.nodeToPath[nodeid]
+	return path, ok
+}
+
+func (p *PathNodeFs) nodeIdFor(path string) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id, ok := p.pathToNode[path]; ok {
+		return id
+	}
+	id := p.nextNodeId
+	p.nextNodeId++
+	p.pathToNode[path] = id
+	p.nodeToPath[id] = path
+	return id
+}
+
+func (p *PathNodeFs) Lookup(parentNodeId uint64, name string, context *fuse.Context) (*fuse.Attr, uint64, fuse.Status) {
+	parent, ok := p.pathOf(parentNodeId)
+	if !ok {
+		return nil, 0, fuse.ENOENT
+	}
+	full := pathJoin(parent, name)
+	a, code := p.fs.GetAttr(full, context)
+	if !code.Ok() {
+		return nil, 0, code
+	}
+	return a, p.nodeIdFor(full), fuse.OK
+}
+
+func (p *PathNodeFs) Forget(nodeid uint64, nlookup uint64) {
+	if nodeid == rootNodeId {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if path, ok := p.nodeToPath[nodeid]; ok {
+		delete(p.nodeToPath, nodeid)
+		delete(p.pathToNode, path)
+	}
+}
+
+func (p *PathNodeFs) GetAttr(nodeid uint64, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	path, ok := p.pathOf(nodeid)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return p.fs.GetAttr(path, context)
+}
+
+// Mkdir translates parentNodeId to a path, dispatches to fs.Mkdir, and -
+// like Lookup - hands the kernel a nodeid for the directory it just
+// created, since MKDIR replies with a fuse_entry_out rather than a bare
+// status.
+func (p *PathNodeFs) Mkdir(parentNodeId uint64, name string, mode uint32, context *fuse.Context) (*fuse.Attr, uint64, fuse.Status) {
+	parent, ok := p.pathOf(parentNodeId)
+	if !ok {
+		return nil, 0, fuse.ENOENT
+	}
+	full := pathJoin(parent, name)
+	if code := p.fs.Mkdir(full, mode, context); !code.Ok() {
+		return nil, 0, code
+	}
+	a, code := p.fs.GetAttr(full, context)
+	if !code.Ok() {
+		return nil, 0, code
+	}
+	return a, p.nodeIdFor(full), fuse.OK
+}
+
+// Unlink translates parentNodeId to a path and dispatches to fs.Unlink.
+func (p *PathNodeFs) Unlink(parentNodeId uint64, name string, context *fuse.Context) fuse.Status {
+	parent, ok := p.pathOf(parentNodeId)
+	if !ok {
+		return fuse.ENOENT
+	}
+	return p.fs.Unlink(pathJoin(parent, name), context)
+}
+
+// Rmdir translates parentNodeId to a path and dispatches to fs.Rmdir.
+func (p *PathNodeFs) Rmdir(parentNodeId uint64, name string, context *fuse.Context) fuse.Status {
+	parent, ok := p.pathOf(parentNodeId)
+	if !ok {
+		return fuse.ENOENT
+	}
+	return p.fs.Rmdir(pathJoin(parent, name), context)
+}
+
+// Open translates nodeid to a path, dispatches to fs.Open, and hands the
+// resulting nodefs.File an opaque handle the kernel can hand back
+// unchanged on the matching Release.
+func (p *PathNodeFs) Open(nodeid uint64, flags uint32, context *fuse.Context) (uint64, fuse.Status) {
+	path, ok := p.pathOf(nodeid)
+	if !ok {
+		return 0, fuse.ENOENT
+	}
+	f, code := p.fs.Open(path, flags, context)
+	if !code.Ok() {
+		return 0, code
+	}
+	p.mu.Lock()
+	fh := p.nextFh
+	p.nextFh++
+	p.handles[fh] = f
+	p.mu.Unlock()
+	return fh, fuse.OK
+}
+
+// Release forgets the nodefs.File associated with fh. fs.Open's result
+// is otherwise unused by PathNodeFs: File is presently just a marker
+// interface with no Read/Write/Close of its own to call here.
+func (p *PathNodeFs) Release(nodeid uint64, fh uint64) {
+	p.mu.Lock()
+	delete(p.handles, fh)
+	p.mu.Unlock()
+}
+
+// GetXAttr implements the raw, nodeid-based half of the two-call
+// size-probe protocol (see fuse.Server), translating nodeid to a path
+// and dispatching through dispatchGetXAttr so NamespacedXAttrFileSystem
+// implementations are consulted.
+func (p *PathNodeFs) GetXAttr(nodeid uint64, attr string, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	path, ok := p.pathOf(nodeid)
+	if !ok {
+		return 0, fuse.ENOENT
+	}
+	return dispatchGetXAttr(p.fs, path, attr, dest, context)
+}
+
+// SetXAttr is the raw counterpart of GetXAttr: it enforces the
+// trusted.* namespace permission check and dispatches to
+// NamespacedXAttrFileSystem.SetNsXAttr when the underlying filesystem
+// implements it, regardless of whether the caller goes through
+// PathNodeFs or some other RawFileSystem front-end.
+func (p *PathNodeFs) SetXAttr(nodeid uint64, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	path, ok := p.pathOf(nodeid)
+	if !ok {
+		return fuse.ENOENT
+	}
+	return dispatchSetXAttr(p.fs, path, attr, data, flags, context)
+}
+
+func (p *PathNodeFs) ListXAttr(nodeid uint64, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	path, ok := p.pathOf(nodeid)
+	if !ok {
+		return 0, fuse.ENOENT
+	}
+	names, code := p.fs.ListXAttr(path, context)
+	if !code.Ok() {
+		return 0, code
+	}
+	buf := encodeXAttrNames(names)
+	if len(dest) == 0 {
+		return len(buf), fuse.OK
+	}
+	if len(dest) < len(buf) {
+		return len(buf), fuse.ERANGE
+	}
+	return copy(dest, buf), fuse.OK
+}
+
+func (p *PathNodeFs) RemoveXAttr(nodeid uint64, attr string, context *fuse.Context) fuse.Status {
+	path, ok := p.pathOf(nodeid)
+	if !ok {
+		return fuse.ENOENT
+	}
+	return p.fs.RemoveXAttr(path, attr, context)
+}
+
+// encodeXAttrNames formats names the way listxattr(2) expects them on
+// the wire: a concatenation of NUL-terminated strings.
+func encodeXAttrNames(names []string) []byte {
+	var buf []byte
+	for _, n := range names {
+		buf = append(buf, n...)
+		buf = append(buf, 0)
+	}
+	return buf
+}
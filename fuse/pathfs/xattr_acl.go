@@ -0,0 +1,77 @@
+package pathfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// posixACLXattrVersion is the only version of the posix_acl_xattr wire
+// format the Linux kernel currently produces or accepts.
+const posixACLXattrVersion = 0x0002
+
+// ACL tag values, mirroring linux/posix_acl_xattr.h.
+const (
+	ACLUserObj  = 0x01
+	ACLUser     = 0x02
+	ACLGroupObj = 0x04
+	ACLGroup    = 0x08
+	ACLMask     = 0x10
+	ACLOther    = 0x20
+)
+
+// aclUndefinedID is ACL_UNDEFINED_ID: the Id kernel fills in for entries
+// that are not ACLUser or ACLGroup.
+const aclUndefinedID = 0xFFFFFFFF
+
+// ACLEntry is a single entry of a POSIX ACL, as carried by the
+// system.posix_acl_access and system.posix_acl_default extended
+// attributes.
+type ACLEntry struct {
+	Tag  uint16
+	Perm uint16
+	// Id is the uid or gid the entry applies to. It is only meaningful
+	// for ACLUser and ACLGroup entries; the kernel writes aclUndefinedID
+	// for the others, and DecodePosixACL returns whatever the data holds.
+	Id uint32
+}
+
+// DecodePosixACL parses the wire format used by
+// system.posix_acl_access/system.posix_acl_default, as produced by the
+// kernel's posix_acl_to_xattr.
+func DecodePosixACL(data []byte) ([]ACLEntry, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("pathfs: posix ACL xattr too short: %d bytes", len(data))
+	}
+	if v := binary.LittleEndian.Uint32(data[:4]); v != posixACLXattrVersion {
+		return nil, fmt.Errorf("pathfs: unsupported posix ACL xattr version %d", v)
+	}
+	rest := data[4:]
+	if len(rest)%8 != 0 {
+		return nil, fmt.Errorf("pathfs: posix ACL xattr has %d trailing bytes", len(rest)%8)
+	}
+	entries := make([]ACLEntry, 0, len(rest)/8)
+	for len(rest) > 0 {
+		entries = append(entries, ACLEntry{
+			Tag:  binary.LittleEndian.Uint16(rest[0:2]),
+			Perm: binary.LittleEndian.Uint16(rest[2:4]),
+			Id:   binary.LittleEndian.Uint32(rest[4:8]),
+		})
+		rest = rest[8:]
+	}
+	return entries, nil
+}
+
+// EncodePosixACL serializes entries into the wire format expected by
+// system.posix_acl_access/system.posix_acl_default, ready to hand back
+// from GetXAttr or to pass to setfacl via SetXAttr.
+func EncodePosixACL(entries []ACLEntry) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint32(posixACLXattrVersion))
+	for _, e := range entries {
+		binary.Write(buf, binary.LittleEndian, e.Tag)
+		binary.Write(buf, binary.LittleEndian, e.Perm)
+		binary.Write(buf, binary.LittleEndian, e.Id)
+	}
+	return buf.Bytes()
+}
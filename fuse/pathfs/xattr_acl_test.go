@@ -0,0 +1,61 @@
+package pathfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitXAttrNamespace(t *testing.T) {
+	cases := []struct {
+		attr      string
+		namespace string
+		name      string
+		ok        bool
+	}{
+		{"security.selinux", "security", "selinux", true},
+		{"system.posix_acl_access", "system", "posix_acl_access", true},
+		{"trusted.overlay.whiteout", "trusted", "overlay.whiteout", true},
+		{"user.attr1", "user", "attr1", true},
+		{"bogus", "", "", false},
+		{"md5sum", "", "", false},
+	}
+	for _, c := range cases {
+		ns, name, ok := SplitXAttrNamespace(c.attr)
+		if ns != c.namespace || name != c.name || ok != c.ok {
+			t.Errorf("SplitXAttrNamespace(%q) = %q, %q, %v, want %q, %q, %v",
+				c.attr, ns, name, ok, c.namespace, c.name, c.ok)
+		}
+	}
+}
+
+func TestEncodeDecodePosixACL(t *testing.T) {
+	entries := []ACLEntry{
+		{Tag: ACLUserObj, Perm: 6, Id: aclUndefinedID},
+		{Tag: ACLUser, Perm: 4, Id: 1000},
+		{Tag: ACLGroupObj, Perm: 6, Id: aclUndefinedID},
+		{Tag: ACLMask, Perm: 6, Id: aclUndefinedID},
+		{Tag: ACLOther, Perm: 0, Id: aclUndefinedID},
+	}
+
+	encoded := EncodePosixACL(entries)
+	decoded, err := DecodePosixACL(encoded)
+	if err != nil {
+		t.Fatalf("DecodePosixACL: %v", err)
+	}
+	if !reflect.DeepEqual(entries, decoded) {
+		t.Errorf("round trip mismatch: got %+v, want %+v", decoded, entries)
+	}
+}
+
+func TestDecodePosixACLErrors(t *testing.T) {
+	if _, err := DecodePosixACL([]byte{0, 1}); err == nil {
+		t.Error("expected error for truncated header")
+	}
+	if _, err := DecodePosixACL([]byte{0xff, 0xff, 0, 0}); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+	bad := append(EncodePosixACL(nil), 0, 0, 0)
+	if _, err := DecodePosixACL(bad); err == nil {
+		t.Error("expected error for trailing bytes")
+	}
+}
@@ -0,0 +1,13 @@
+package pathfs
+
+// Flags accepted by FileSystem.SetXAttr, mirroring setxattr(2). They are
+// not always exported by the syscall package, so pathfs defines its own
+// copies with the same numeric values.
+const (
+	// XATTR_CREATE requires that the named attribute does not already
+	// exist; SetXAttr should fail with fuse.EEXIST if it does.
+	XATTR_CREATE = 0x1
+	// XATTR_REPLACE requires that the named attribute already exists;
+	// SetXAttr should fail with fuse.ENODATA if it does not.
+	XATTR_REPLACE = 0x2
+)
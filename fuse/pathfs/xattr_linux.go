@@ -0,0 +1,134 @@
+package pathfs
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// VerboseTest reports whether tests should turn on FUSE debug logging,
+// controlled by the GOFUSE_DEBUG environment variable.
+func VerboseTest() bool {
+	return os.Getenv("GOFUSE_DEBUG") != ""
+}
+
+// getXAttr calls getxattr(2) directly, following its two-call size-probe
+// protocol: a nil/empty dest performs the sizing call and returns a
+// slice whose length is the size that would be needed, without reading
+// any data; a non-empty dest performs the data call and returns the
+// value trimmed to the bytes actually written.
+func getXAttr(path, attr string, dest []byte) ([]byte, error) {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	attrPtr, err := syscall.BytePtrFromString(attr)
+	if err != nil {
+		return nil, err
+	}
+
+	var valPtr unsafe.Pointer
+	if len(dest) > 0 {
+		valPtr = unsafe.Pointer(&dest[0])
+	}
+
+	r, _, errno := syscall.Syscall6(syscall.SYS_GETXATTR,
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(attrPtr)),
+		uintptr(valPtr),
+		uintptr(len(dest)),
+		0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	if len(dest) == 0 {
+		return make([]byte, int(r)), nil
+	}
+	return dest[:int(r)], nil
+}
+
+// listXAttr calls listxattr(2), probing for the required size before
+// fetching the NUL-separated name list.
+func listXAttr(path string) ([]string, error) {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, _, errno := syscall.Syscall(syscall.SYS_LISTXATTR, uintptr(unsafe.Pointer(pathPtr)), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	if r == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, int(r))
+	r2, _, errno := syscall.Syscall(syscall.SYS_LISTXATTR,
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)))
+	if errno != 0 {
+		return nil, errno
+	}
+
+	var names []string
+	for _, chunk := range bytes.Split(buf[:int(r2)], []byte{0}) {
+		if len(chunk) > 0 {
+			names = append(names, string(chunk))
+		}
+	}
+	return names, nil
+}
+
+// sysSetxattr calls setxattr(2), honoring XATTR_CREATE/XATTR_REPLACE in
+// flags.
+func sysSetxattr(path, attr string, data []byte, flags int) error {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	attrPtr, err := syscall.BytePtrFromString(attr)
+	if err != nil {
+		return err
+	}
+
+	var valPtr unsafe.Pointer
+	if len(data) > 0 {
+		valPtr = unsafe.Pointer(&data[0])
+	}
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETXATTR,
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(attrPtr)),
+		uintptr(valPtr),
+		uintptr(len(data)),
+		uintptr(flags),
+		0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// sysRemovexattr calls removexattr(2).
+func sysRemovexattr(path, attr string) error {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	attrPtr, err := syscall.BytePtrFromString(attr)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_REMOVEXATTR,
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(attrPtr)),
+		0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
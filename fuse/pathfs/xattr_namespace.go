@@ -0,0 +1,108 @@
+package pathfs
+
+import (
+	"strings"
+
+	"github.com/bpowers/go-fuse/fuse"
+)
+
+// Extended attribute namespaces recognized by Linux; see xattr(7).
+const (
+	XAttrNamespaceUser     = "user"
+	XAttrNamespaceTrusted  = "trusted"
+	XAttrNamespaceSecurity = "security"
+	XAttrNamespaceSystem   = "system"
+)
+
+// Well-known names carrying SELinux labels, Linux capabilities, and
+// POSIX ACLs, respectively.
+const (
+	XAttrSELinux    = "security.selinux"
+	XAttrCapability = "security.capability"
+	XAttrACLAccess  = "system.posix_acl_access"
+	XAttrACLDefault = "system.posix_acl_default"
+)
+
+// SplitXAttrNamespace splits a fully qualified extended attribute name
+// such as "security.selinux" into its namespace ("security") and the
+// remainder of the name ("selinux"). ok is false if attr does not start
+// with one of the namespaces Linux recognizes.
+func SplitXAttrNamespace(attr string) (namespace, name string, ok bool) {
+	i := strings.IndexByte(attr, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	ns := attr[:i]
+	switch ns {
+	case XAttrNamespaceUser, XAttrNamespaceTrusted, XAttrNamespaceSecurity, XAttrNamespaceSystem:
+		return ns, attr[i+1:], true
+	}
+	return "", "", false
+}
+
+// NamespacedXAttrFileSystem is an optional extension of FileSystem for
+// filesystems that need to treat extended attributes differently
+// depending on their namespace - e.g. to expose POSIX ACLs or SELinux
+// labels - rather than as opaque strings. PathNodeFs checks for this
+// interface before falling back to the plain Get/Set XAttr methods.
+type NamespacedXAttrFileSystem interface {
+	FileSystem
+
+	// GetNsXAttr behaves like FileSystem.GetXAttr, but additionally
+	// receives the namespace parsed from attr (one of the
+	// XAttrNamespace* constants).
+	GetNsXAttr(name string, namespace string, attr string, dest []byte, context *fuse.Context) (sz int, code fuse.Status)
+
+	// SetNsXAttr behaves like FileSystem.SetXAttr, but additionally
+	// receives the namespace parsed from attr.
+	SetNsXAttr(name string, namespace string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status
+}
+
+// checkXAttrNamespacePermission reports whether context is allowed to
+// write an attribute in namespace. Only a caller running as root (or
+// with CAP_SYS_ADMIN, which we approximate with the uid==0 check since
+// the raw FUSE request does not carry capability sets) may set
+// trusted.* attributes; the kernel itself has already applied the usual
+// file permission checks for the other namespaces by the time a request
+// reaches us.
+func checkXAttrNamespacePermission(namespace string, context *fuse.Context) fuse.Status {
+	if namespace != XAttrNamespaceTrusted {
+		return fuse.OK
+	}
+	if context != nil && context.Owner.Uid == 0 {
+		return fuse.OK
+	}
+	return fuse.EPERM
+}
+
+// dispatchGetXAttr is the single place PathNodeFs.GetXAttr routes
+// through: if fs implements NamespacedXAttrFileSystem and attr carries a
+// recognized namespace, GetNsXAttr is called with that namespace parsed
+// out; otherwise this falls back to the plain FileSystem.GetXAttr.
+func dispatchGetXAttr(fs FileSystem, name string, attr string, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	if nfs, ok := fs.(NamespacedXAttrFileSystem); ok {
+		if ns, rest, ok := SplitXAttrNamespace(attr); ok {
+			return nfs.GetNsXAttr(name, ns, rest, dest, context)
+		}
+	}
+	return fs.GetXAttr(name, attr, dest, context)
+}
+
+// dispatchSetXAttr is the counterpart of dispatchGetXAttr for writes. It
+// always enforces checkXAttrNamespacePermission for a recognized
+// namespace - even when fs doesn't implement NamespacedXAttrFileSystem -
+// so trusted.* is rejected for non-root callers regardless of whether
+// the backing filesystem is namespace-aware.
+func dispatchSetXAttr(fs FileSystem, name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	ns, rest, ok := SplitXAttrNamespace(attr)
+	if !ok {
+		return fs.SetXAttr(name, attr, data, flags, context)
+	}
+	if code := checkXAttrNamespacePermission(ns, context); !code.Ok() {
+		return code
+	}
+	if nfs, ok := fs.(NamespacedXAttrFileSystem); ok {
+		return nfs.SetNsXAttr(name, ns, rest, data, flags, context)
+	}
+	return fs.SetXAttr(name, attr, data, flags, context)
+}
@@ -0,0 +1,74 @@
+package pathfs
+
+import (
+	"testing"
+
+	"github.com/bpowers/go-fuse/fuse"
+)
+
+func TestCheckXAttrNamespacePermission(t *testing.T) {
+	root := &fuse.Context{Owner: fuse.Owner{Uid: 0}}
+	nonRoot := &fuse.Context{Owner: fuse.Owner{Uid: 1000}}
+
+	if code := checkXAttrNamespacePermission(XAttrNamespaceTrusted, nonRoot); code.Ok() {
+		t.Error("non-root was allowed to touch trusted.*")
+	}
+	if code := checkXAttrNamespacePermission(XAttrNamespaceTrusted, root); !code.Ok() {
+		t.Errorf("root was denied trusted.*: %v", code)
+	}
+	for _, ns := range []string{XAttrNamespaceUser, XAttrNamespaceSecurity, XAttrNamespaceSystem} {
+		if code := checkXAttrNamespacePermission(ns, nonRoot); !code.Ok() {
+			t.Errorf("non-root was denied %s.*: %v", ns, code)
+		}
+	}
+}
+
+// nsXAttrFs is a minimal NamespacedXAttrFileSystem fixture used to check
+// that dispatchGetXAttr/dispatchSetXAttr actually call into the Ns
+// variants, and that the trusted.* permission check runs before they do.
+type nsXAttrFs struct {
+	set map[string][]byte
+
+	FileSystem
+}
+
+func newNsXAttrFs() *nsXAttrFs {
+	return &nsXAttrFs{set: make(map[string][]byte), FileSystem: NewDefaultFileSystem()}
+}
+
+func (fs *nsXAttrFs) GetNsXAttr(name, namespace, attr string, dest []byte, context *fuse.Context) (int, fuse.Status) {
+	v, ok := fs.set[namespace+"."+attr]
+	if !ok {
+		return 0, fuse.ENODATA
+	}
+	return copy(dest, v), fuse.OK
+}
+
+func (fs *nsXAttrFs) SetNsXAttr(name, namespace, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	fs.set[namespace+"."+attr] = append([]byte(nil), data...)
+	return fuse.OK
+}
+
+func TestDispatchXAttrUsesNamespacedMethods(t *testing.T) {
+	fs := newNsXAttrFs()
+	root := &fuse.Context{Owner: fuse.Owner{Uid: 0}}
+
+	if code := dispatchSetXAttr(fs, "f", "security.selinux", []byte("label"), 0, root); !code.Ok() {
+		t.Fatalf("dispatchSetXAttr failed: %v", code)
+	}
+	dest := make([]byte, 16)
+	n, code := dispatchGetXAttr(fs, "f", "security.selinux", dest, root)
+	if !code.Ok() || string(dest[:n]) != "label" {
+		t.Errorf("dispatchGetXAttr = %q, %v, want \"label\", OK", dest[:n], code)
+	}
+}
+
+func TestDispatchSetXAttrRejectsTrustedForNonRoot(t *testing.T) {
+	fs := newNsXAttrFs()
+	nonRoot := &fuse.Context{Owner: fuse.Owner{Uid: 1000}}
+
+	code := dispatchSetXAttr(fs, "f", "trusted.overlay.whiteout", []byte{'y'}, 0, nonRoot)
+	if code != fuse.EPERM {
+		t.Errorf("dispatchSetXAttr(trusted.*, non-root) = %v, want EPERM", code)
+	}
+}
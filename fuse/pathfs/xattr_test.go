@@ -56,22 +56,39 @@ func (fs *XAttrTestFs) SetXAttr(name string, attr string, data []byte, flags int
 	if name != fs.filename {
 		return fuse.ENOENT
 	}
+	_, exists := fs.attrs[attr]
+	switch {
+	case flags&XATTR_CREATE != 0 && exists:
+		return fuse.Status(syscall.EEXIST)
+	case flags&XATTR_REPLACE != 0 && !exists:
+		return fuse.ENODATA
+	}
 	dest := make([]byte, len(data))
 	copy(dest, data)
 	fs.attrs[attr] = dest
 	return fuse.OK
 }
 
-func (fs *XAttrTestFs) GetXAttr(name string, attr string, context *fuse.Context) ([]byte, fuse.Status) {
+// GetXAttr follows the two-call size-probe protocol documented for
+// getxattr(2): a zero-length dest asks for the required size without
+// copying any data, and a dest that is too small to hold the value
+// returns ERANGE together with the size that would have been needed.
+func (fs *XAttrTestFs) GetXAttr(name string, attr string, dest []byte, context *fuse.Context) (int, fuse.Status) {
 	if name != fs.filename {
-		return nil, fuse.ENOENT
+		return 0, fuse.ENOENT
 	}
 	v, ok := fs.attrs[attr]
 	if !ok {
-		return nil, fuse.ENODATA
+		return 0, fuse.ENODATA
 	}
 	fs.tester.Log("GetXAttr", string(v))
-	return v, fuse.OK
+	if len(dest) == 0 {
+		return len(v), fuse.OK
+	}
+	if len(dest) < len(v) {
+		return len(v), fuse.Status(syscall.ERANGE)
+	}
+	return copy(dest, v), fuse.OK
 }
 
 func (fs *XAttrTestFs) ListXAttr(name string, context *fuse.Context) (data []string, code fuse.Status) {
@@ -99,8 +116,18 @@ func (fs *XAttrTestFs) RemoveXAttr(name string, attr string, context *fuse.Conte
 }
 
 func readXAttr(p, a string) (val []byte, err error) {
-	val = make([]byte, 1024)
-	return getXAttr(p, a, val)
+	// Probe for the required size first, rather than guessing at a
+	// fixed buffer: large attributes (ACLs, SELinux labels,
+	// security.capability v3 blobs) can exceed a hard-coded guess and
+	// would otherwise be silently truncated.
+	sz, err := getXAttr(p, a, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(sz) == 0 {
+		return sz, nil
+	}
+	return getXAttr(p, a, make([]byte, len(sz)))
 }
 
 func xattrTestCase(t *testing.T, nm string) (mountPoint string, cleanup func()) {
@@ -187,3 +214,77 @@ func TestXAttrRead(t *testing.T) {
 		t.Error("Data not removed?", err, val)
 	}
 }
+
+func TestXAttrSizeProbe(t *testing.T) {
+	nm := xattrFilename
+	mountPoint, clean := xattrTestCase(t, nm)
+	defer clean()
+
+	mounted := filepath.Join(mountPoint, nm)
+	golden := xattrGolden["user.attr1"]
+
+	// the sizing call: a zero-length buffer must report the size
+	// without returning data or an error.
+	sz, err := getXAttr(mounted, "user.attr1", nil)
+	if err != nil {
+		t.Fatalf("sizing GetXAttr failed: %v", err)
+	}
+	if len(sz) != len(golden) {
+		t.Errorf("sizing call reported %d bytes, want %d", len(sz), len(golden))
+	}
+
+	// too-small a buffer must fail with ERANGE rather than truncate.
+	_, err = getXAttr(mounted, "user.attr1", make([]byte, 1))
+	if err != syscall.ERANGE {
+		t.Errorf("undersized GetXAttr = %v, want ERANGE", err)
+	}
+
+	// the data call: a correctly sized buffer returns the value.
+	val, err := getXAttr(mounted, "user.attr1", make([]byte, len(golden)))
+	if err != nil || bytes.Compare(val, golden) != 0 {
+		t.Errorf("data call = %q, %v, want %q, nil", val, err, golden)
+	}
+}
+
+func TestXAttrCreateReplaceFlags(t *testing.T) {
+	nm := xattrFilename
+	mountPoint, clean := xattrTestCase(t, nm)
+	defer clean()
+
+	mounted := filepath.Join(mountPoint, nm)
+
+	// XATTR_REPLACE on a name that does not exist yet must fail.
+	err := sysSetxattr(mounted, "fresh", []byte("v1"), XATTR_REPLACE)
+	if err != syscall.ENODATA {
+		t.Errorf("Setxattr(REPLACE, missing) = %v, want ENODATA", err)
+	}
+
+	// XATTR_CREATE on the same, as-yet-unset name must succeed.
+	if err := sysSetxattr(mounted, "fresh", []byte("v1"), XATTR_CREATE); err != nil {
+		t.Fatalf("Setxattr(CREATE, missing) failed: %v", err)
+	}
+	if val, err := readXAttr(mounted, "fresh"); err != nil || string(val) != "v1" {
+		t.Errorf("readback after create = %q, %v, want v1, nil", val, err)
+	}
+
+	// XATTR_CREATE on an existing name must fail with EEXIST.
+	err = sysSetxattr(mounted, "fresh", []byte("v2"), XATTR_CREATE)
+	if err != syscall.EEXIST {
+		t.Errorf("Setxattr(CREATE, existing) = %v, want EEXIST", err)
+	}
+
+	// XATTR_REPLACE on an existing name must succeed.
+	if err := sysSetxattr(mounted, "fresh", []byte("v2"), XATTR_REPLACE); err != nil {
+		t.Fatalf("Setxattr(REPLACE, existing) failed: %v", err)
+	}
+	if val, err := readXAttr(mounted, "fresh"); err != nil || string(val) != "v2" {
+		t.Errorf("readback after replace = %q, %v, want v2, nil", val, err)
+	}
+
+	// Removexattr after a prior Get must actually remove the
+	// attribute: a later Get reports ENODATA.
+	sysRemovexattr(mounted, "fresh")
+	if _, err := readXAttr(mounted, "fresh"); err != syscall.ENODATA {
+		t.Errorf("readback after remove = %v, want ENODATA", err)
+	}
+}
@@ -0,0 +1,22 @@
+package fuse
+
+// Protocol is the FUSE kernel ABI version negotiated during INIT.
+type Protocol struct {
+	Major uint32
+	Minor uint32
+}
+
+// protoInvalidateMinor is the minor version at which the kernel gained
+// support for FUSE_NOTIFY_INVAL_INODE/FUSE_NOTIFY_INVAL_ENTRY.
+const protoInvalidateMinor = 12
+
+// HasInvalidate reports whether the negotiated protocol supports
+// server-initiated cache invalidation notifications.
+func (p Protocol) HasInvalidate() bool {
+	return p.Major > 7 || (p.Major == 7 && p.Minor >= protoInvalidateMinor)
+}
+
+// GE reports whether the negotiated protocol is at least major.minor.
+func (p Protocol) GE(major, minor uint32) bool {
+	return p.Major > major || (p.Major == major && p.Minor >= minor)
+}
@@ -0,0 +1,31 @@
+package fuse
+
+// RawFileSystem is the interface the kernel dispatch loop in Server
+// talks to. pathfs.PathNodeFs implements this directly, and is what
+// nodefs.MountRoot hands to NewServer; it is a much thinner,
+// nodeid-oriented surface than pathfs.FileSystem, which operates on full
+// path strings instead.
+type RawFileSystem interface {
+	String() string
+	SetDebug(debug bool)
+
+	// Init is called once, after the kernel and server have negotiated
+	// a protocol version, so the filesystem can record it (e.g. to
+	// gate invalidation support on Protocol.HasInvalidate).
+	Init(server *Server)
+
+	Lookup(nodeid uint64, name string, context *Context) (*Attr, uint64, Status)
+	Forget(nodeid uint64, nlookup uint64)
+	GetAttr(nodeid uint64, context *Context) (*Attr, Status)
+
+	Mkdir(nodeid uint64, name string, mode uint32, context *Context) (*Attr, uint64, Status)
+	Unlink(nodeid uint64, name string, context *Context) Status
+	Rmdir(nodeid uint64, name string, context *Context) Status
+	Open(nodeid uint64, flags uint32, context *Context) (fh uint64, code Status)
+	Release(nodeid uint64, fh uint64)
+
+	GetXAttr(nodeid uint64, attr string, dest []byte, context *Context) (size int, code Status)
+	SetXAttr(nodeid uint64, attr string, data []byte, flags int, context *Context) Status
+	ListXAttr(nodeid uint64, dest []byte, context *Context) (size int, code Status)
+	RemoveXAttr(nodeid uint64, attr string, context *Context) Status
+}
@@ -0,0 +1,338 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// negotiatedMinor is the protocol minor version Server always requests.
+// 13 is old enough (kernel 2.6.36, 2010) to be supported everywhere this
+// library is likely to run, while still including the invalidation
+// notifications PathNodeFs.NotifyXAttr/NotifyEntry depend on (added at
+// minor 12).
+const negotiatedMinor = 13
+
+// maxWrite bounds how much payload Server will ever send or receive in a
+// single request; it only needs to comfortably fit xattr values.
+const maxWrite = 1 << 20
+
+// Server owns the /dev/fuse file descriptor for one mount and dispatches
+// kernel requests to a RawFileSystem.
+type Server struct {
+	fs         RawFileSystem
+	mountPoint string
+
+	fd int
+
+	mu        sync.Mutex
+	proto     Protocol
+	debug     bool
+	unmounted bool
+}
+
+// NewServer opens /dev/fuse, performs the mount(2) for mountPoint, and
+// returns a Server ready to have Serve called on it. The actual
+// FUSE_INIT handshake happens lazily, as the first message Serve reads.
+func NewServer(fs RawFileSystem, mountPoint string) (*Server, error) {
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("fuse: open /dev/fuse: %v", err)
+	}
+
+	data := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d", fd, S_IFDIR, os.Getuid(), os.Getgid())
+	if err := syscall.Mount("fuse", mountPoint, "fuse", 0, data); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("fuse: mount %q: %v", mountPoint, err)
+	}
+
+	return &Server{fs: fs, mountPoint: mountPoint, fd: fd}, nil
+}
+
+func (s *Server) SetDebug(debug bool) {
+	s.mu.Lock()
+	s.debug = debug
+	s.mu.Unlock()
+}
+
+func (s *Server) isDebug() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.debug
+}
+
+// Protocol returns the protocol version negotiated with the kernel. It
+// is only valid once the FUSE_INIT exchange has happened, i.e. after
+// Serve has processed its first message.
+func (s *Server) Protocol() Protocol {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.proto
+}
+
+func (s *Server) setProtocol(p Protocol) {
+	s.mu.Lock()
+	s.proto = p
+	s.mu.Unlock()
+}
+
+// Unmount detaches the filesystem and stops Serve's read loop.
+func (s *Server) Unmount() error {
+	s.mu.Lock()
+	if s.unmounted {
+		s.mu.Unlock()
+		return nil
+	}
+	s.unmounted = true
+	s.mu.Unlock()
+
+	err := syscall.Unmount(s.mountPoint, 0)
+	syscall.Close(s.fd)
+	return err
+}
+
+// Serve reads and dispatches kernel requests until the filesystem is
+// unmounted. It is meant to be run in its own goroutine, matching the
+// "go state.Serve()" idiom used throughout this package's tests.
+func (s *Server) Serve() error {
+	buf := make([]byte, maxWrite+4096)
+	for {
+		n, err := syscall.Read(s.fd, buf)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			// ENODEV/EBADF: the mount point was unmounted out from
+			// under us; treat that as a clean shutdown.
+			return nil
+		}
+		if n < sizeOfInHeader {
+			continue
+		}
+		s.dispatch(buf[:n])
+	}
+}
+
+func (s *Server) dispatch(msg []byte) {
+	var h inHeader
+	r := bytes.NewReader(msg[:sizeOfInHeader])
+	binary.Read(r, binary.LittleEndian, &h)
+	body := msg[sizeOfInHeader:]
+	context := &Context{Owner: Owner{Uid: h.Uid, Gid: h.Gid}, Pid: h.Pid}
+
+	if s.isDebug() {
+		fmt.Fprintf(os.Stderr, "fuse: opcode=%d nodeid=%d unique=%d\n", h.Opcode, h.NodeId, h.Unique)
+	}
+
+	switch h.Opcode {
+	case opInit:
+		s.replyInit(h, body)
+	case opDestroy:
+		s.writeReply(h.Unique, OK, nil)
+	case opForget:
+		var in forgetIn
+		binary.Read(bytes.NewReader(body), binary.LittleEndian, &in)
+		s.fs.Forget(h.NodeId, in.Nlookup)
+		// FORGET has no reply.
+	case opLookup:
+		name := cString(body)
+		attr, nodeid, code := s.fs.Lookup(h.NodeId, name, context)
+		if !code.Ok() {
+			s.writeReply(h.Unique, code, nil)
+			return
+		}
+		out := entryOut{NodeId: nodeid, Attr: toWireAttr(attr)}
+		s.writeReply(h.Unique, OK, encode(out))
+	case opGetAttr:
+		attr, code := s.fs.GetAttr(h.NodeId, context)
+		if !code.Ok() {
+			s.writeReply(h.Unique, code, nil)
+			return
+		}
+		out := attrOut{Attr: toWireAttr(attr)}
+		s.writeReply(h.Unique, OK, encode(out))
+	case opMkdir:
+		var in mkdirIn
+		binary.Read(bytes.NewReader(body), binary.LittleEndian, &in)
+		name := cString(body[8:])
+		attr, nodeid, code := s.fs.Mkdir(h.NodeId, name, in.Mode, context)
+		if !code.Ok() {
+			s.writeReply(h.Unique, code, nil)
+			return
+		}
+		out := entryOut{NodeId: nodeid, Attr: toWireAttr(attr)}
+		s.writeReply(h.Unique, OK, encode(out))
+	case opUnlink:
+		name := cString(body)
+		code := s.fs.Unlink(h.NodeId, name, context)
+		s.writeReply(h.Unique, code, nil)
+	case opRmdir:
+		name := cString(body)
+		code := s.fs.Rmdir(h.NodeId, name, context)
+		s.writeReply(h.Unique, code, nil)
+	case opOpen:
+		var in openIn
+		binary.Read(bytes.NewReader(body), binary.LittleEndian, &in)
+		fh, code := s.fs.Open(h.NodeId, in.Flags, context)
+		if !code.Ok() {
+			s.writeReply(h.Unique, code, nil)
+			return
+		}
+		s.writeReply(h.Unique, OK, encode(openOut{Fh: fh}))
+	case opRelease:
+		var in releaseIn
+		binary.Read(bytes.NewReader(body), binary.LittleEndian, &in)
+		s.fs.Release(h.NodeId, in.Fh)
+		s.writeReply(h.Unique, OK, nil)
+	case opFlush:
+		// Server has no buffered writes to flush and no FileSystem
+		// hook for it; acknowledge so close(2) doesn't surface ENOSYS
+		// to every caller the way an unhandled opcode would.
+		s.writeReply(h.Unique, OK, nil)
+	case opGetXAttr:
+		s.replyGetXAttr(h, body, context)
+	case opListXAttr:
+		s.replyListXAttr(h, body, context)
+	case opSetXAttr:
+		s.replySetXAttr(h, body, context)
+	case opRemoveXAttr:
+		name := cString(body)
+		code := s.fs.RemoveXAttr(h.NodeId, name, context)
+		s.writeReply(h.Unique, code, nil)
+	case opAccess:
+		// Server doesn't implement permission checking beyond what
+		// FileSystem.GetAttr's mode bits already tell the kernel, so
+		// just grant access.
+		s.writeReply(h.Unique, OK, nil)
+	default:
+		s.writeReply(h.Unique, ENOSYS, nil)
+	}
+}
+
+func (s *Server) replyInit(h inHeader, body []byte) {
+	var in initIn
+	binary.Read(bytes.NewReader(body), binary.LittleEndian, &in)
+
+	minor := in.Minor
+	if minor > negotiatedMinor {
+		minor = negotiatedMinor
+	}
+	s.setProtocol(Protocol{Major: 7, Minor: minor})
+	s.fs.Init(s)
+
+	out := initOut{
+		Major:        7,
+		Minor:        minor,
+		MaxReadahead: in.MaxReadahead,
+		MaxWrite:     maxWrite,
+	}
+	s.writeReply(h.Unique, OK, encode(out))
+}
+
+func (s *Server) replyGetXAttr(h inHeader, body []byte, context *Context) {
+	var in getXAttrIn
+	r := bytes.NewReader(body)
+	binary.Read(r, binary.LittleEndian, &in)
+	name := cString(body[8:])
+
+	dest := make([]byte, in.Size)
+	sz, code := s.fs.GetXAttr(h.NodeId, name, dest, context)
+	if !code.Ok() {
+		s.writeReply(h.Unique, code, nil)
+		return
+	}
+	if in.Size == 0 {
+		s.writeReply(h.Unique, OK, encode(getXAttrOut{Size: uint32(sz)}))
+		return
+	}
+	s.writeReply(h.Unique, OK, dest[:sz])
+}
+
+func (s *Server) replyListXAttr(h inHeader, body []byte, context *Context) {
+	var in getXAttrIn
+	binary.Read(bytes.NewReader(body), binary.LittleEndian, &in)
+
+	dest := make([]byte, in.Size)
+	sz, code := s.fs.ListXAttr(h.NodeId, dest, context)
+	if !code.Ok() {
+		s.writeReply(h.Unique, code, nil)
+		return
+	}
+	if in.Size == 0 {
+		s.writeReply(h.Unique, OK, encode(getXAttrOut{Size: uint32(sz)}))
+		return
+	}
+	s.writeReply(h.Unique, OK, dest[:sz])
+}
+
+func (s *Server) replySetXAttr(h inHeader, body []byte, context *Context) {
+	var in setXAttrIn
+	r := bytes.NewReader(body)
+	binary.Read(r, binary.LittleEndian, &in)
+
+	rest := body[8:]
+	nameEnd := bytes.IndexByte(rest, 0)
+	name := string(rest[:nameEnd])
+	data := rest[nameEnd+1 : nameEnd+1+int(in.Size)]
+
+	code := s.fs.SetXAttr(h.NodeId, name, data, int(in.Flags), context)
+	s.writeReply(h.Unique, code, nil)
+}
+
+func (s *Server) writeReply(unique uint64, code Status, payload []byte) {
+	out := outHeader{
+		Len:    uint32(sizeOfOutHeader + len(payload)),
+		Error:  -int32(code),
+		Unique: unique,
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, out)
+	buf.Write(payload)
+	syscall.Write(s.fd, buf.Bytes())
+}
+
+// InodeNotify asks the kernel to drop any cached attributes/data for
+// nodeid, as used by PathNodeFs.NotifyXAttr.
+func (s *Server) InodeNotify(nodeid uint64, off int64, length int64) Status {
+	payload := encode(notifyInvalInodeOut{Ino: nodeid, Off: off, Len: length})
+	return s.sendNotify(notifyInvalInode, payload)
+}
+
+// EntryNotify asks the kernel to drop the cached dentry name under
+// parent, as used by PathNodeFs.NotifyEntry.
+func (s *Server) EntryNotify(parent uint64, name string) Status {
+	head := encode(notifyInvalEntryOut{Parent: parent, Namelen: uint32(len(name))})
+	payload := append(head, append([]byte(name), 0)...)
+	return s.sendNotify(notifyInvalEntry, payload)
+}
+
+func (s *Server) sendNotify(code int32, payload []byte) Status {
+	out := outHeader{
+		Len:    uint32(sizeOfOutHeader + len(payload)),
+		Error:  -code,
+		Unique: 0,
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, out)
+	buf.Write(payload)
+	if _, err := syscall.Write(s.fd, buf.Bytes()); err != nil {
+		return EIO
+	}
+	return OK
+}
+
+func encode(v interface{}) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, v)
+	return buf.Bytes()
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
@@ -0,0 +1,88 @@
+// Package fuse provides the low-level types and raw kernel dispatch that
+// the nodefs and pathfs packages build on: the FUSE wire-protocol status
+// codes, the per-request Context, and the Attr/DirEntry shapes returned
+// by filesystem implementations.
+package fuse
+
+import "syscall"
+
+// Status is a FUSE/errno-style result code. OK means success; any other
+// value is a (positive) errno, which Server negates when it replies to
+// the kernel.
+type Status int32
+
+// Ok reports whether s represents success.
+func (s Status) Ok() bool {
+	return s == OK
+}
+
+func (s Status) String() string {
+	if s == OK {
+		return "OK"
+	}
+	return syscall.Errno(s).Error()
+}
+
+// Common status codes filesystems return from FileSystem/RawFileSystem
+// methods.
+var (
+	OK        = Status(0)
+	EIO       = Status(syscall.EIO)
+	ENOENT    = Status(syscall.ENOENT)
+	ENODATA   = Status(syscall.ENODATA)
+	ERANGE    = Status(syscall.ERANGE)
+	EPERM     = Status(syscall.EPERM)
+	EEXIST    = Status(syscall.EEXIST)
+	EINVAL    = Status(syscall.EINVAL)
+	ENOSYS    = Status(syscall.ENOSYS)
+	EISDIR    = Status(syscall.EISDIR)
+	ENOTDIR   = Status(syscall.ENOTDIR)
+	ENOTEMPTY = Status(syscall.ENOTEMPTY)
+)
+
+// Owner is the uid/gid pair a request was made under.
+type Owner struct {
+	Uid uint32
+	Gid uint32
+}
+
+// Context carries the per-request identity of the caller, as reported by
+// the kernel alongside each operation.
+type Context struct {
+	Owner
+	Pid uint32
+}
+
+// File mode bits used in Attr.Mode and DirEntry.Mode.
+const (
+	S_IFDIR = 0040000
+	S_IFREG = 0100000
+	S_IFLNK = 0120000
+)
+
+// Attr mirrors the subset of struct stat the kernel needs for GETATTR
+// and LOOKUP replies.
+type Attr struct {
+	Ino       uint64
+	Size      uint64
+	Blocks    uint64
+	Atime     uint64
+	Mtime     uint64
+	Ctime     uint64
+	Atimensec uint32
+	Mtimensec uint32
+	Ctimensec uint32
+	Mode      uint32
+	Nlink     uint32
+	Owner
+	Rdev    uint32
+	Blksize uint32
+}
+
+// DirEntry is a single entry of a directory listing, as returned from
+// FileSystem.OpenDir.
+type DirEntry struct {
+	Mode uint32
+	Name string
+	Ino  uint64
+}
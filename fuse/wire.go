@@ -0,0 +1,182 @@
+package fuse
+
+// Wire structs below mirror the layout the kernel uses on /dev/fuse
+// (see <linux/fuse.h>). Field names match the kernel's where practical.
+// Server only needs the handful of messages its dispatched opcodes and
+// invalidation notifications actually use.
+
+type inHeader struct {
+	Len     uint32
+	Opcode  uint32
+	Unique  uint64
+	NodeId  uint64
+	Uid     uint32
+	Gid     uint32
+	Pid     uint32
+	Padding uint32
+}
+
+const sizeOfInHeader = 40
+
+type outHeader struct {
+	Len    uint32
+	Error  int32
+	Unique uint64
+}
+
+const sizeOfOutHeader = 16
+
+// wireAttr is struct fuse_attr (88 bytes).
+type wireAttr struct {
+	Ino       uint64
+	Size      uint64
+	Blocks    uint64
+	Atime     uint64
+	Mtime     uint64
+	Ctime     uint64
+	Atimensec uint32
+	Mtimensec uint32
+	Ctimensec uint32
+	Mode      uint32
+	Nlink     uint32
+	Uid       uint32
+	Gid       uint32
+	Rdev      uint32
+	Blksize   uint32
+	Padding   uint32
+}
+
+func toWireAttr(a *Attr) wireAttr {
+	return wireAttr{
+		Ino: a.Ino, Size: a.Size, Blocks: a.Blocks,
+		Atime: a.Atime, Mtime: a.Mtime, Ctime: a.Ctime,
+		Atimensec: a.Atimensec, Mtimensec: a.Mtimensec, Ctimensec: a.Ctimensec,
+		Mode: a.Mode, Nlink: a.Nlink, Uid: a.Owner.Uid, Gid: a.Owner.Gid,
+		Rdev: a.Rdev, Blksize: a.Blksize,
+	}
+}
+
+// entryOut is struct fuse_entry_out (128 bytes): the LOOKUP reply.
+type entryOut struct {
+	NodeId         uint64
+	Generation     uint64
+	EntryValid     uint64
+	AttrValid      uint64
+	EntryValidNsec uint32
+	AttrValidNsec  uint32
+	Attr           wireAttr
+}
+
+// attrOut is struct fuse_attr_out (104 bytes): the GETATTR reply.
+type attrOut struct {
+	AttrValid     uint64
+	AttrValidNsec uint32
+	Padding       uint32
+	Attr          wireAttr
+}
+
+// getAttrIn is struct fuse_getattr_in (16 bytes): the GETATTR request
+// body. Server never reads it - GETATTR replies are always computed
+// fresh from the node id in the header.
+type getAttrIn struct {
+	GetAttrFlags uint32
+	Dummy        uint32
+	Fh           uint64
+}
+
+// forgetIn is struct fuse_forget_in (8 bytes).
+type forgetIn struct {
+	Nlookup uint64
+}
+
+// mkdirIn is struct fuse_mkdir_in (8 bytes): the MKDIR request body,
+// followed by the NUL-terminated name to create.
+type mkdirIn struct {
+	Mode  uint32
+	Umask uint32
+}
+
+// openIn is struct fuse_open_in (8 bytes): the OPEN request body.
+type openIn struct {
+	Flags  uint32
+	Unused uint32
+}
+
+// openOut is struct fuse_open_out (16 bytes): the OPEN reply. Fh is
+// whatever Server makes up to identify the handle in a later RELEASE;
+// OpenFlags is left zero since Server doesn't support FOPEN_DIRECT_IO or
+// the other flags it gates.
+type openOut struct {
+	Fh        uint64
+	OpenFlags uint32
+	Padding   uint32
+}
+
+// releaseIn is struct fuse_release_in (24 bytes): the RELEASE request
+// body. Only Fh is used; the lock-related fields are unused by Server.
+type releaseIn struct {
+	Fh           uint64
+	Flags        uint32
+	ReleaseFlags uint32
+	LockOwner    uint64
+}
+
+// getXAttrIn is struct fuse_getxattr_in (8 bytes), also reused by
+// LISTXATTR requests; the attribute name (for GETXATTR) follows as a
+// NUL-terminated string.
+type getXAttrIn struct {
+	Size    uint32
+	Padding uint32
+}
+
+// getXAttrOut is struct fuse_getxattr_out (8 bytes): sent in place of
+// the raw attribute value when Size in the request was 0, i.e. the
+// sizing half of the two-call size-probe protocol.
+type getXAttrOut struct {
+	Size    uint32
+	Padding uint32
+}
+
+// setXAttrIn is struct fuse_setxattr_in (8 bytes): followed by the
+// NUL-terminated attribute name and then Size bytes of value data.
+type setXAttrIn struct {
+	Size  uint32
+	Flags uint32
+}
+
+// initIn is the request body of FUSE_INIT; only the leading fields are
+// read, any trailing bytes newer kernels append are ignored.
+type initIn struct {
+	Major        uint32
+	Minor        uint32
+	MaxReadahead uint32
+	Flags        uint32
+}
+
+// initOut is the FUSE_INIT reply understood by any kernel supporting
+// protocol minor >= 13 - old enough to be universal - which is all
+// Server ever negotiates.
+type initOut struct {
+	Major               uint32
+	Minor               uint32
+	MaxReadahead        uint32
+	Flags               uint32
+	MaxBackground       uint16
+	CongestionThreshold uint16
+	MaxWrite            uint32
+}
+
+// notifyInvalInodeOut is struct fuse_notify_inval_inode_out (24 bytes).
+type notifyInvalInodeOut struct {
+	Ino uint64
+	Off int64
+	Len int64
+}
+
+// notifyInvalEntryOut is struct fuse_notify_inval_entry_out (16 bytes),
+// followed by the NUL-terminated entry name.
+type notifyInvalEntryOut struct {
+	Parent  uint64
+	Namelen uint32
+	Padding uint32
+}